@@ -0,0 +1,178 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDefault(t *testing.T) {
+	c := &KubeSchedulerConfiguration{}
+	c.Default()
+
+	if c.ListenAddress != ":8181" {
+		t.Errorf("ListenAddress = %v, want :8181", c.ListenAddress)
+	}
+	if c.PolicyDir != "policies" {
+		t.Errorf("PolicyDir = %v, want policies", c.PolicyDir)
+	}
+	if c.FitDocument != "/io/k8s/scheduler/fit" {
+		t.Errorf("FitDocument = %v, want /io/k8s/scheduler/fit", c.FitDocument)
+	}
+	if c.LeaderElection.LeaseDuration.Duration != 15*time.Second {
+		t.Errorf("LeaderElection.LeaseDuration = %v, want 15s", c.LeaderElection.LeaseDuration.Duration)
+	}
+	if len(c.Reflectors) != len(DefaultReflectors()) {
+		t.Errorf("len(Reflectors) = %v, want %v", len(c.Reflectors), len(DefaultReflectors()))
+	}
+}
+
+func TestDefaultDoesNotOverrideSetFields(t *testing.T) {
+	c := &KubeSchedulerConfiguration{ListenAddress: ":9999"}
+	c.Default()
+
+	if c.ListenAddress != ":9999" {
+		t.Errorf("ListenAddress = %v, want :9999", c.ListenAddress)
+	}
+}
+
+func TestMergeReflectors(t *testing.T) {
+
+	defaults := []ReflectorConfiguration{
+		{Name: "a", FieldSelector: "default-a"},
+		{Name: "b", FieldSelector: "default-b"},
+	}
+
+	cases := []struct {
+		note      string
+		overrides []ReflectorConfiguration
+		want      []ReflectorConfiguration
+	}{
+		{
+			note:      "no overrides keeps defaults",
+			overrides: nil,
+			want:      defaults,
+		},
+		{
+			note:      "override replaces a known reflector's field selector",
+			overrides: []ReflectorConfiguration{{Name: "a", FieldSelector: "custom-a"}},
+			want: []ReflectorConfiguration{
+				{Name: "a", FieldSelector: "custom-a"},
+				{Name: "b", FieldSelector: "default-b"},
+			},
+		},
+		{
+			note:      "override naming an unknown reflector is appended, not dropped",
+			overrides: []ReflectorConfiguration{{Name: "c", FieldSelector: "custom-c"}},
+			want: []ReflectorConfiguration{
+				{Name: "a", FieldSelector: "default-a"},
+				{Name: "b", FieldSelector: "default-b"},
+				{Name: "c", FieldSelector: "custom-c"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			got := mergeReflectors(defaults, tc.overrides)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("[%d] got %v, want %v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func validConfig() *KubeSchedulerConfiguration {
+	c := &KubeSchedulerConfiguration{}
+	c.Default()
+	return c
+}
+
+func TestValidate(t *testing.T) {
+
+	t.Run("a defaulted configuration is valid", func(t *testing.T) {
+		if err := validConfig().Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejects a non-absolute fitDocument", func(t *testing.T) {
+		c := validConfig()
+		c.FitDocument = "io/k8s/scheduler/fit"
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for relative fitDocument")
+		}
+	})
+
+	t.Run("rejects an unknown reflector name", func(t *testing.T) {
+		c := validConfig()
+		c.Reflectors = append(c.Reflectors, ReflectorConfiguration{Name: "bogus"})
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for unknown reflector name")
+		}
+	})
+
+	t.Run("rejects an extender with no verbs set", func(t *testing.T) {
+		c := validConfig()
+		c.Extenders = []ExtenderConfiguration{{URLPrefix: "http://extender"}}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for extender with no verbs")
+		}
+	})
+
+	t.Run("rejects more than one extender setting bindVerb", func(t *testing.T) {
+		c := validConfig()
+		c.Extenders = []ExtenderConfiguration{
+			{URLPrefix: "http://a", BindVerb: "bind"},
+			{URLPrefix: "http://b", BindVerb: "bind"},
+		}
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected error for two bind-capable extenders")
+		}
+	})
+
+	t.Run("allows exactly one extender setting bindVerb", func(t *testing.T) {
+		c := validConfig()
+		c.Extenders = []ExtenderConfiguration{
+			{URLPrefix: "http://a", BindVerb: "bind"},
+			{URLPrefix: "http://b", FilterVerb: "filter"},
+		}
+		if err := c.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestLoadDoesNotValidate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "opa-kube-scheduler-config-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(`fitDocument: "not-absolute"`), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load should not validate, got error: %v", err)
+	}
+
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected the loaded configuration to fail Validate")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package v1alpha1
+
+import "time"
+
+// Default fills in zero-valued fields of c with the scheduler's historical
+// defaults (the same values the old flags defaulted to).
+func (c *KubeSchedulerConfiguration) Default() {
+
+	if c.APIVersion == "" {
+		c.APIVersion = "config.opa-kube-scheduler.io/v1alpha1"
+	}
+
+	if c.Kind == "" {
+		c.Kind = "KubeSchedulerConfiguration"
+	}
+
+	if c.ListenAddress == "" {
+		c.ListenAddress = ":8181"
+	}
+
+	if c.PolicyDir == "" {
+		c.PolicyDir = "policies"
+	}
+
+	if c.FitDocument == "" {
+		c.FitDocument = "/io/k8s/scheduler/fit"
+	}
+
+	if c.PreemptDocument == "" {
+		c.PreemptDocument = "/io/k8s/scheduler/preempt"
+	}
+
+	if c.MetricsBindAddress == "" {
+		c.MetricsBindAddress = ":10251"
+	}
+
+	if c.ClientConnection.QPS == 0 {
+		c.ClientConnection.QPS = 50
+	}
+
+	if c.ClientConnection.Burst == 0 {
+		c.ClientConnection.Burst = 100
+	}
+
+	if c.ClientConnection.ContentType == "" {
+		c.ClientConnection.ContentType = "application/json"
+	}
+
+	if c.LeaderElection.LeaseDuration.Duration == 0 {
+		c.LeaderElection.LeaseDuration.Duration = 15 * time.Second
+	}
+
+	if c.LeaderElection.RenewDeadline.Duration == 0 {
+		c.LeaderElection.RenewDeadline.Duration = 10 * time.Second
+	}
+
+	if c.LeaderElection.RetryPeriod.Duration == 0 {
+		c.LeaderElection.RetryPeriod.Duration = 2 * time.Second
+	}
+
+	if c.LeaderElection.ResourceName == "" {
+		c.LeaderElection.ResourceName = "opa-kube-scheduler"
+	}
+
+	if c.LeaderElection.ResourceNamespace == "" {
+		c.LeaderElection.ResourceNamespace = "kube-system"
+	}
+
+	c.Reflectors = mergeReflectors(DefaultReflectors(), c.Reflectors)
+}
+
+// mergeReflectors overlays overrides onto defaults, matching entries by
+// Name. Overrides naming a reflector that doesn't exist are kept as-is so
+// that Validate can reject them with a clear error.
+func mergeReflectors(defaults, overrides []ReflectorConfiguration) []ReflectorConfiguration {
+	byName := make(map[string]ReflectorConfiguration, len(defaults))
+	order := make([]string, 0, len(defaults))
+
+	for _, d := range defaults {
+		byName[d.Name] = d
+		order = append(order, d.Name)
+	}
+
+	for _, o := range overrides {
+		if _, ok := byName[o.Name]; !ok {
+			order = append(order, o.Name)
+		}
+		byName[o.Name] = o
+	}
+
+	merged := make([]ReflectorConfiguration, len(order))
+	for i, name := range order {
+		merged[i] = byName[name]
+	}
+
+	return merged
+}
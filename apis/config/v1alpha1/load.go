@@ -0,0 +1,32 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package v1alpha1
+
+import (
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// Load reads the configuration file at path (YAML or JSON; ghodss/yaml
+// accepts both) and defaults it. It does not validate the result: callers
+// that still support the deprecated flat flags need a chance to apply
+// those overrides first, so validation is the caller's responsibility
+// (see KubeSchedulerConfiguration.Validate).
+func Load(path string) (*KubeSchedulerConfiguration, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &KubeSchedulerConfiguration{}
+	if err := yaml.Unmarshal(bs, c); err != nil {
+		return nil, err
+	}
+
+	c.Default()
+
+	return c, nil
+}
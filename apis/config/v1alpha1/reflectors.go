@@ -0,0 +1,30 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package v1alpha1
+
+// Names of the reflectors the scheduler starts. These are stable
+// identifiers used to match a ReflectorConfiguration override against the
+// reflector it applies to; they are not Kubernetes resource types, since
+// "unscheduled pods" and "scheduled pods" both reflect the "pods" resource
+// but with different field selectors and handling.
+const (
+	ReflectorUnscheduledPods        = "unscheduledPods"
+	ReflectorScheduledPods          = "scheduledPods"
+	ReflectorNodes                  = "nodes"
+	ReflectorServices               = "services"
+	ReflectorReplicationControllers = "replicationControllers"
+)
+
+// DefaultReflectors returns the field selectors the scheduler has always
+// used for each reflector.
+func DefaultReflectors() []ReflectorConfiguration {
+	return []ReflectorConfiguration{
+		{Name: ReflectorUnscheduledPods, FieldSelector: "spec.nodeName==,status.phase!=Succeeded,status.phase!=Failed"},
+		{Name: ReflectorScheduledPods, FieldSelector: "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed"},
+		{Name: ReflectorNodes, FieldSelector: "spec.unschedulable=false"},
+		{Name: ReflectorServices, FieldSelector: ""},
+		{Name: ReflectorReplicationControllers, FieldSelector: ""},
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package v1alpha1 defines the on-disk configuration schema for
+// opa-kube-scheduler. It is loaded from a ConfigMap-mounted file named by
+// the --config flag and replaces the ad-hoc flags that used to be the only
+// way to configure the scheduler.
+package v1alpha1
+
+import (
+	"encoding/json"
+	"time"
+
+	"k8s.io/kubernetes/pkg/client/restclient"
+)
+
+// KubeSchedulerConfiguration is the top-level configuration object for
+// opa-kube-scheduler.
+type KubeSchedulerConfiguration struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+
+	// ClientConnection describes how the scheduler talks to the API server.
+	ClientConnection ClientConnectionConfiguration `json:"clientConnection"`
+
+	// LeaderElection configures whether and how replicas of the scheduler
+	// coordinate so only one of them schedules pods at a time.
+	LeaderElection LeaderElectionConfiguration `json:"leaderElection"`
+
+	// MetricsBindAddress is the address the Prometheus metrics, pprof,
+	// /healthz, and /readyz endpoints are served on. Default replaces an
+	// empty value with ":10251", so these endpoints are always served.
+	MetricsBindAddress string `json:"metricsBindAddress,omitempty"`
+
+	// PolicyDir is the directory OPA policies are loaded from and pushed
+	// into by the bundled OPA HTTP server.
+	PolicyDir string `json:"policyDir"`
+
+	// ListenAddress is the address the bundled OPA HTTP server listens on.
+	ListenAddress string `json:"listenAddress"`
+
+	// FitDocument is the path of the document queried to rank candidate
+	// nodes for a pod, e.g. "/io/k8s/scheduler/fit".
+	FitDocument string `json:"fitDocument"`
+
+	// PreemptDocument is the path of the document queried to find victims
+	// to evict when no node fits a pod, e.g. "/io/k8s/scheduler/preempt".
+	PreemptDocument string `json:"preemptDocument"`
+
+	// Extenders lists out-of-process extenders consulted alongside the OPA
+	// policy during scheduling.
+	Extenders []ExtenderConfiguration `json:"extenders,omitempty"`
+
+	// Reflectors overrides the field selectors used to watch each resource
+	// type. Entries are merged by Name with DefaultReflectors: an entry
+	// replaces the default entry of the same Name whole, so an entry that
+	// omits fieldSelector watches with an empty field selector.
+	Reflectors []ReflectorConfiguration `json:"reflectors,omitempty"`
+}
+
+// ClientConnectionConfiguration describes how to build the REST client used
+// to talk to the Kubernetes API server.
+type ClientConnectionConfiguration struct {
+	Kubeconfig  string  `json:"kubeconfig,omitempty"`
+	QPS         float32 `json:"qps,omitempty"`
+	Burst       int32   `json:"burst,omitempty"`
+	ContentType string  `json:"contentType,omitempty"`
+}
+
+// LeaderElectionConfiguration describes the leader election client-go uses
+// to determine which replica of the scheduler is active.
+type LeaderElectionConfiguration struct {
+	LeaderElect       bool     `json:"leaderElect,omitempty"`
+	LeaseDuration     Duration `json:"leaseDuration,omitempty"`
+	RenewDeadline     Duration `json:"renewDeadline,omitempty"`
+	RetryPeriod       Duration `json:"retryPeriod,omitempty"`
+	ResourceName      string   `json:"resourceName,omitempty"`
+	ResourceNamespace string   `json:"resourceNamespace,omitempty"`
+}
+
+// ExtenderConfiguration describes a single out-of-process extender. See
+// pkg.ExtenderConfig for how these fields are used.
+type ExtenderConfiguration struct {
+	URLPrefix        string                      `json:"urlPrefix"`
+	FilterVerb       string                      `json:"filterVerb,omitempty"`
+	PrioritizeVerb   string                      `json:"prioritizeVerb,omitempty"`
+	Weight           int                         `json:"weight,omitempty"`
+	BindVerb         string                      `json:"bindVerb,omitempty"`
+	ManagedResources []string                    `json:"managedResources,omitempty"`
+	Ignorable        bool                        `json:"ignorable,omitempty"`
+	HTTPTimeout      Duration                    `json:"httpTimeout,omitempty"`
+	TLSConfig        *restclient.TLSClientConfig `json:"tlsConfig,omitempty"`
+}
+
+// ReflectorConfiguration overrides the field selector used for the
+// reflector named Name (one of the constants in reflectors.go).
+type ReflectorConfiguration struct {
+	Name          string `json:"name"`
+	FieldSelector string `json:"fieldSelector"`
+}
+
+// Duration is a time.Duration that marshals to/from JSON and YAML as a
+// string (e.g. "15s") instead of an integer count of nanoseconds.
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
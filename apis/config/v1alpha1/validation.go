@@ -0,0 +1,81 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validate returns an error describing every problem found with c, or nil
+// if c is usable as-is. Callers should call Default before Validate so that
+// defaulted fields aren't reported as missing.
+func (c *KubeSchedulerConfiguration) Validate() error {
+	var errs []string
+
+	if c.ListenAddress == "" {
+		errs = append(errs, "listenAddress must not be empty")
+	}
+
+	if c.PolicyDir == "" {
+		errs = append(errs, "policyDir must not be empty")
+	}
+
+	if !isAbsDocPath(c.FitDocument) {
+		errs = append(errs, "fitDocument must be an absolute document path, e.g. /io/k8s/scheduler/fit")
+	}
+
+	if !isAbsDocPath(c.PreemptDocument) {
+		errs = append(errs, "preemptDocument must be an absolute document path, e.g. /io/k8s/scheduler/preempt")
+	}
+
+	if c.LeaderElection.LeaderElect {
+		if c.LeaderElection.ResourceName == "" {
+			errs = append(errs, "leaderElection.resourceName must not be empty when leaderElect is true")
+		}
+		if c.LeaderElection.ResourceNamespace == "" {
+			errs = append(errs, "leaderElection.resourceNamespace must not be empty when leaderElect is true")
+		}
+	}
+
+	binders := 0
+
+	for i, e := range c.Extenders {
+		if e.URLPrefix == "" {
+			errs = append(errs, fmt.Sprintf("extenders[%d].urlPrefix must not be empty", i))
+		}
+		if e.FilterVerb == "" && e.PrioritizeVerb == "" && e.BindVerb == "" {
+			errs = append(errs, fmt.Sprintf("extenders[%d] must set at least one of filterVerb, prioritizeVerb, bindVerb", i))
+		}
+		if e.BindVerb != "" {
+			binders++
+		}
+	}
+
+	if binders > 1 {
+		errs = append(errs, "extenders: at most one extender may set bindVerb")
+	}
+
+	defaultNames := make(map[string]bool)
+	for _, d := range DefaultReflectors() {
+		defaultNames[d.Name] = true
+	}
+
+	for _, r := range c.Reflectors {
+		if !defaultNames[r.Name] {
+			errs = append(errs, fmt.Sprintf("reflectors: unknown reflector name %q", r.Name))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid configuration: %v", strings.Join(errs, "; "))
+}
+
+func isAbsDocPath(p string) bool {
+	return len(p) > 0 && p[0] == '/'
+}
@@ -5,42 +5,63 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/golang/glog"
+	configv1alpha1 "github.com/open-policy-agent/opa-kube-scheduler/apis/config/v1alpha1"
+	"github.com/open-policy-agent/opa-kube-scheduler/pkg"
 	"github.com/open-policy-agent/opa/server"
 	"github.com/open-policy-agent/opa/storage"
-	"github.com/open-policy-agent/opa-kube-scheduler/pkg"
 	"k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
 )
 
 func cmdServer(c *config) {
 
-	if err := os.MkdirAll(c.policyDir, 0755); err != nil {
+	conf := c.buildConfiguration()
+
+	if err := os.MkdirAll(conf.PolicyDir, 0755); err != nil {
 		glog.Fatalf("Unable to create policy directory: %v.", err)
 	}
 
-	store := storage.New(storage.InMemoryConfig().WithPolicyDir(c.policyDir))
+	store := storage.New(storage.InMemoryConfig().WithPolicyDir(conf.PolicyDir))
 
 	if err := store.Open(); err != nil {
 		glog.Fatalf("Unable open storage: %v.", err)
 	}
 
-	server, err := server.New(store, c.listenAddr, true)
+	server, err := server.New(store, conf.ListenAddress, true)
 	if err != nil {
 		glog.Fatalf("Unable to create server: %v.", err)
 	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", c.kubeconfigPath)
-
+	restConfig, err := clientcmd.BuildConfigFromFlags("", conf.ClientConnection.Kubeconfig)
 	if err != nil {
 		glog.Fatalf("Unable to get REST client configuration: %v", err)
 	}
 
-	scheduler := pkg.New(server, store, parsePath(c.fitDoc), config)
+	restConfig.QPS = conf.ClientConnection.QPS
+	restConfig.Burst = int(conf.ClientConnection.Burst)
+	restConfig.ContentType = conf.ClientConnection.ContentType
+
+	scheduler, err := pkg.New(server, store, restConfig, conf)
+	if err != nil {
+		glog.Fatalf("Unable to create scheduler: %v.", err)
+	}
+
+	if conf.MetricsBindAddress != "" {
+		go func() {
+			handler := pkg.NewMetricsHandler(scheduler.Ready)
+			if err := http.ListenAndServe(conf.MetricsBindAddress, handler); err != nil {
+				glog.Errorf("Metrics server exited: %v", err)
+			}
+		}()
+	}
 
 	if err := scheduler.Start(); err != nil {
 		glog.Fatalf("Unable to start scheduler: %v.", err)
@@ -55,35 +76,140 @@ func cmdPrintVersion() {
 	fmt.Println(pkg.Version)
 }
 
+// config holds the process's flags. The --config flag names a
+// configv1alpha1.KubeSchedulerConfiguration file; the rest are deprecated
+// in its favor and, when explicitly set, override the value loaded from
+// that file.
 type config struct {
-	showVersion    bool
-	listenAddr     string
-	policyDir      string
-	kubeconfigPath string
-	fitDoc         string
+	showVersion bool
+	configFile  string
+
+	listenAddr         string
+	policyDir          string
+	kubeconfigPath     string
+	fitDoc             string
+	preemptDoc         string
+	extenderConfig     string
+	metricsBindAddress string
+
+	leaderElect                  bool
+	leaderElectLeaseDuration     time.Duration
+	leaderElectRenewDeadline     time.Duration
+	leaderElectRetryPeriod       time.Duration
+	leaderElectResourceName      string
+	leaderElectResourceNamespace string
 }
 
 func parseArgs() *config {
 	c := config{}
 	flag.BoolVar(&c.showVersion, "version", false, "print the scheduler version and exit")
-	flag.StringVar(&c.listenAddr, "listen_addr", ":8181", "set the listening address of the server")
-	flag.StringVar(&c.policyDir, "policy_dir", "policies", "set the path of the directory to store policies")
-	flag.StringVar(&c.fitDoc, "fit", "/io/k8s/scheduler/fit", "set the path of the fit document")
-	flag.StringVar(&c.kubeconfigPath, "kubeconfig", "", "set the path of the kubeconfig file")
+	flag.StringVar(&c.configFile, "config", "", "set the path of the scheduler configuration file (YAML or JSON)")
+	flag.StringVar(&c.listenAddr, "listen_addr", ":8181", "deprecated: set listenAddress in the --config file instead")
+	flag.StringVar(&c.policyDir, "policy_dir", "policies", "deprecated: set policyDir in the --config file instead")
+	flag.StringVar(&c.fitDoc, "fit", "/io/k8s/scheduler/fit", "deprecated: set fitDocument in the --config file instead")
+	flag.StringVar(&c.preemptDoc, "preempt", "/io/k8s/scheduler/preempt", "deprecated: set preemptDocument in the --config file instead")
+	flag.StringVar(&c.kubeconfigPath, "kubeconfig", "", "deprecated: set clientConnection.kubeconfig in the --config file instead")
+	flag.StringVar(&c.extenderConfig, "extender_config", "", "deprecated: set extenders in the --config file instead (JSON array of extender configs)")
+	flag.StringVar(&c.metricsBindAddress, "metrics-bind-address", ":10251", "deprecated: set metricsBindAddress in the --config file instead")
+	flag.BoolVar(&c.leaderElect, "leader-elect", false, "deprecated: set leaderElection.leaderElect in the --config file instead")
+	flag.DurationVar(&c.leaderElectLeaseDuration, "leader-elect-lease-duration", 15*time.Second, "deprecated: set leaderElection.leaseDuration in the --config file instead")
+	flag.DurationVar(&c.leaderElectRenewDeadline, "leader-elect-renew-deadline", 10*time.Second, "deprecated: set leaderElection.renewDeadline in the --config file instead")
+	flag.DurationVar(&c.leaderElectRetryPeriod, "leader-elect-retry-period", 2*time.Second, "deprecated: set leaderElection.retryPeriod in the --config file instead")
+	flag.StringVar(&c.leaderElectResourceName, "leader-elect-resource-name", "opa-kube-scheduler", "deprecated: set leaderElection.resourceName in the --config file instead")
+	flag.StringVar(&c.leaderElectResourceNamespace, "leader-elect-resource-namespace", "kube-system", "deprecated: set leaderElection.resourceNamespace in the --config file instead")
 	flag.Parse()
 	return &c
 }
 
-func parsePath(p string) []interface{} {
-	if p[0] != '/' {
-		glog.Fatalf("Invalid path: %v", p)
+// buildConfiguration loads the --config file, if any, defaults it, applies
+// any deprecated flags the user explicitly set on top, validates the
+// result, and returns it. It calls glog.Fatalf on any error, matching the
+// rest of cmdServer's startup sequence.
+func (c *config) buildConfiguration() *configv1alpha1.KubeSchedulerConfiguration {
+
+	var conf *configv1alpha1.KubeSchedulerConfiguration
+
+	if c.configFile != "" {
+		loaded, err := configv1alpha1.Load(c.configFile)
+		if err != nil {
+			glog.Fatalf("Unable to load configuration file: %v.", err)
+		}
+		conf = loaded
+	} else {
+		conf = &configv1alpha1.KubeSchedulerConfiguration{}
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if set["listen_addr"] {
+		conf.ListenAddress = c.listenAddr
+	}
+	if set["policy_dir"] {
+		conf.PolicyDir = c.policyDir
+	}
+	if set["fit"] {
+		conf.FitDocument = c.fitDoc
+	}
+	if set["preempt"] {
+		conf.PreemptDocument = c.preemptDoc
+	}
+	if set["kubeconfig"] {
+		conf.ClientConnection.Kubeconfig = c.kubeconfigPath
 	}
-	parts := strings.Split(p[1:], "/")
-	r := make([]interface{}, len(parts))
-	for i := range parts {
-		r[i] = parts[i]
+	if set["extender_config"] {
+		extenders, err := loadExtenderConfigurations(c.extenderConfig)
+		if err != nil {
+			glog.Fatalf("Unable to load extender configuration: %v.", err)
+		}
+		conf.Extenders = extenders
 	}
-	return r
+	if set["metrics-bind-address"] {
+		conf.MetricsBindAddress = c.metricsBindAddress
+	}
+	if set["leader-elect"] {
+		conf.LeaderElection.LeaderElect = c.leaderElect
+	}
+	if set["leader-elect-lease-duration"] {
+		conf.LeaderElection.LeaseDuration.Duration = c.leaderElectLeaseDuration
+	}
+	if set["leader-elect-renew-deadline"] {
+		conf.LeaderElection.RenewDeadline.Duration = c.leaderElectRenewDeadline
+	}
+	if set["leader-elect-retry-period"] {
+		conf.LeaderElection.RetryPeriod.Duration = c.leaderElectRetryPeriod
+	}
+	if set["leader-elect-resource-name"] {
+		conf.LeaderElection.ResourceName = c.leaderElectResourceName
+	}
+	if set["leader-elect-resource-namespace"] {
+		conf.LeaderElection.ResourceNamespace = c.leaderElectResourceNamespace
+	}
+
+	conf.Default()
+
+	if err := conf.Validate(); err != nil {
+		glog.Fatalf("Invalid configuration: %v.", err)
+	}
+
+	return conf
+}
+
+// loadExtenderConfigurations reads the deprecated --extender_config file
+// format: a bare JSON array of extender configs, rather than the
+// "extenders" field of a full KubeSchedulerConfiguration file.
+func loadExtenderConfigurations(path string) ([]configv1alpha1.ExtenderConfiguration, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var extenders []configv1alpha1.ExtenderConfiguration
+	if err := json.Unmarshal(bs, &extenders); err != nil {
+		return nil, err
+	}
+
+	return extenders, nil
 }
 
 func main() {
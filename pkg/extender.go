@@ -0,0 +1,298 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/kubernetes/pkg/client/restclient"
+
+	"github.com/open-policy-agent/opa-kube-scheduler/apis/config/v1alpha1"
+)
+
+// ExtenderConfig describes how the scheduler should talk to a single
+// out-of-process extender. It mirrors the configuration accepted by the
+// upstream kube-scheduler so that existing extenders (GPU schedulers,
+// topology-aware schedulers, vendor-specific schedulers, etc.) can be
+// reused without modification.
+type ExtenderConfig struct {
+	// URLPrefix is prepended to FilterVerb/PrioritizeVerb/BindVerb to build
+	// the full request URL, e.g. "http://127.0.0.1:8888/scheduler".
+	URLPrefix string `json:"urlPrefix"`
+
+	// FilterVerb is the verb appended to URLPrefix when filtering nodes. If
+	// empty, the extender is not consulted during filtering.
+	FilterVerb string `json:"filterVerb,omitempty"`
+
+	// PrioritizeVerb is the verb appended to URLPrefix when scoring nodes.
+	// If empty, the extender is not consulted during prioritization.
+	PrioritizeVerb string `json:"prioritizeVerb,omitempty"`
+
+	// Weight is multiplied into the scores returned by PrioritizeVerb before
+	// they are added into the scheduler's rankings.
+	Weight int `json:"weight,omitempty"`
+
+	// BindVerb is the verb appended to URLPrefix to delegate binding to the
+	// extender. At most one configured extender may set this.
+	BindVerb string `json:"bindVerb,omitempty"`
+
+	// ManagedResources, if non-empty, restricts this extender to pods that
+	// request at least one of the named resources.
+	ManagedResources []string `json:"managedResources,omitempty"`
+
+	// Ignorable controls whether a failed call to this extender fails the
+	// scheduling attempt (false, the default) or is merely logged (true).
+	Ignorable bool `json:"ignorable,omitempty"`
+
+	// HTTPTimeout bounds how long the scheduler waits on a single request.
+	HTTPTimeout time.Duration `json:"httpTimeout,omitempty"`
+
+	// TLSConfig is used to secure communication with the extender when
+	// URLPrefix uses https.
+	TLSConfig *restclient.TLSClientConfig `json:"tlsConfig,omitempty"`
+}
+
+// Extender is an out-of-process participant in scheduling decisions. It is
+// consulted, in order, alongside the OPA policy evaluated by schedulePod.
+type Extender struct {
+	config *ExtenderConfig
+	client *http.Client
+}
+
+// extendersFromConfig converts the versioned extender configuration loaded
+// from the scheduler's configuration file into Extenders.
+func extendersFromConfig(configs []v1alpha1.ExtenderConfiguration) ([]*Extender, error) {
+	out := make([]ExtenderConfig, len(configs))
+	for i, c := range configs {
+		out[i] = ExtenderConfig{
+			URLPrefix:        c.URLPrefix,
+			FilterVerb:       c.FilterVerb,
+			PrioritizeVerb:   c.PrioritizeVerb,
+			Weight:           c.Weight,
+			BindVerb:         c.BindVerb,
+			ManagedResources: c.ManagedResources,
+			Ignorable:        c.Ignorable,
+			HTTPTimeout:      c.HTTPTimeout.Duration,
+			TLSConfig:        c.TLSConfig,
+		}
+	}
+	return NewExtenders(out)
+}
+
+// NewExtenders builds an Extender for each of the given configs.
+func NewExtenders(configs []ExtenderConfig) ([]*Extender, error) {
+	result := make([]*Extender, len(configs))
+	for i := range configs {
+		e, err := newExtender(&configs[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = e
+	}
+	return result, nil
+}
+
+func newExtender(config *ExtenderConfig) (*Extender, error) {
+	transport := http.DefaultTransport
+	if config.TLSConfig != nil {
+		tlsConfig, err := restclient.TLSConfigFor(&restclient.Config{TLSClientConfig: *config.TLSConfig})
+		if err != nil {
+			return nil, err
+		}
+		transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	timeout := config.HTTPTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &Extender{
+		config: config,
+		client: &http.Client{Transport: transport, Timeout: timeout},
+	}, nil
+}
+
+// IsBinder returns true if this extender has been configured to handle
+// binding instead of the scheduler's internal binding logic.
+func (e *Extender) IsBinder() bool {
+	return e.config.BindVerb != ""
+}
+
+// manages reports whether pod requests or limits at least one of the
+// resources named in config.ManagedResources. An extender with no
+// ManagedResources configured manages every pod.
+func (e *Extender) manages(pod map[string]interface{}) bool {
+	if len(e.config.ManagedResources) == 0 {
+		return true
+	}
+
+	spec, ok := pod["spec"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	containers, ok := spec["containers"].([]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		resources, ok := container["resources"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, field := range []string{"requests", "limits"} {
+			amounts, ok := resources[field].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, name := range e.config.ManagedResources {
+				if _, ok := amounts[name]; ok {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// ExtenderArgs is the payload sent to an extender's filter and prioritize
+// endpoints.
+type ExtenderArgs struct {
+	Pod       map[string]interface{} `json:"pod"`
+	NodeNames []string               `json:"nodeNames"`
+}
+
+// ExtenderFilterResult is returned by an extender's filter endpoint.
+type ExtenderFilterResult struct {
+	NodeNames   []string          `json:"nodeNames,omitempty"`
+	FailedNodes map[string]string `json:"failedNodes,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// HostPriority records an extender's score for a single node.
+type HostPriority struct {
+	Host  string `json:"host"`
+	Score int    `json:"score"`
+}
+
+// HostPriorityList is returned by an extender's prioritize endpoint.
+type HostPriorityList []HostPriority
+
+// ExtenderBindingArgs is the payload sent to an extender's bind endpoint.
+type ExtenderBindingArgs struct {
+	PodName      string `json:"podName"`
+	PodNamespace string `json:"podNamespace"`
+	PodUID       string `json:"podUID"`
+	Node         string `json:"node"`
+}
+
+// ExtenderBindingResult is returned by an extender's bind endpoint.
+type ExtenderBindingResult struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Filter asks the extender to narrow nodeNames down to the nodes it
+// considers feasible for pod. If the extender does not implement filtering,
+// nodeNames is returned unmodified.
+func (e *Extender) Filter(pod map[string]interface{}, nodeNames []string) ([]string, error) {
+	if e.config.FilterVerb == "" {
+		return nodeNames, nil
+	}
+
+	args := &ExtenderArgs{Pod: pod, NodeNames: nodeNames}
+	result := &ExtenderFilterResult{}
+
+	if err := e.send(e.config.FilterVerb, args, result); err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, fmt.Errorf("extender %v: %v", e.config.URLPrefix, result.Error)
+	}
+
+	return result.NodeNames, nil
+}
+
+// Prioritize asks the extender to score each of nodeNames for pod.
+func (e *Extender) Prioritize(pod map[string]interface{}, nodeNames []string) (HostPriorityList, int, error) {
+	if e.config.PrioritizeVerb == "" {
+		return nil, 0, nil
+	}
+
+	args := &ExtenderArgs{Pod: pod, NodeNames: nodeNames}
+	result := &HostPriorityList{}
+
+	if err := e.send(e.config.PrioritizeVerb, args, result); err != nil {
+		return nil, 0, err
+	}
+
+	weight := e.config.Weight
+	if weight == 0 {
+		weight = 1
+	}
+
+	return *result, weight, nil
+}
+
+// Bind delegates binding of pod to node to the extender.
+func (e *Extender) Bind(podName, podNamespace, podUID, node string) error {
+	args := &ExtenderBindingArgs{
+		PodName:      podName,
+		PodNamespace: podNamespace,
+		PodUID:       podUID,
+		Node:         node,
+	}
+	result := &ExtenderBindingResult{}
+
+	if err := e.send(e.config.BindVerb, args, result); err != nil {
+		return err
+	}
+
+	if result.Error != "" {
+		return fmt.Errorf("extender %v: %v", e.config.URLPrefix, result.Error)
+	}
+
+	return nil
+}
+
+func (e *Extender) send(verb string, args interface{}, result interface{}) error {
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(args); err != nil {
+		return err
+	}
+
+	url := e.config.URLPrefix + "/" + verb
+
+	req, err := http.NewRequest("POST", url, buf)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpErr(req, resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestExtender starts an httptest server implementing filter, prioritize
+// and bind the way a real extender would, and returns an Extender wired to
+// talk to it.
+func newTestExtender(t *testing.T, config ExtenderConfig) (*Extender, *httptest.Server) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/"+config.FilterVerb, func(w http.ResponseWriter, r *http.Request) {
+		var args ExtenderArgs
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			t.Fatalf("decode filter args: %v", err)
+		}
+
+		var kept []string
+		for _, n := range args.NodeNames {
+			if n != "node-bad" {
+				kept = append(kept, n)
+			}
+		}
+
+		json.NewEncoder(w).Encode(&ExtenderFilterResult{NodeNames: kept})
+	})
+
+	if config.PrioritizeVerb != "" {
+		mux.HandleFunc("/"+config.PrioritizeVerb, func(w http.ResponseWriter, r *http.Request) {
+			var args ExtenderArgs
+			if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+				t.Fatalf("decode prioritize args: %v", err)
+			}
+
+			result := make(HostPriorityList, len(args.NodeNames))
+			for i, n := range args.NodeNames {
+				result[i] = HostPriority{Host: n, Score: 1}
+			}
+
+			json.NewEncoder(w).Encode(&result)
+		})
+	}
+
+	if config.BindVerb != "" {
+		mux.HandleFunc("/"+config.BindVerb, func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(&ExtenderBindingResult{})
+		})
+	}
+
+	server := httptest.NewServer(mux)
+
+	config.URLPrefix = server.URL
+	e, err := newExtender(&config)
+	if err != nil {
+		t.Fatalf("newExtender: %v", err)
+	}
+
+	return e, server
+}
+
+func TestExtenderFilterAndPrioritize(t *testing.T) {
+
+	e, server := newTestExtender(t, ExtenderConfig{FilterVerb: "filter", PrioritizeVerb: "prioritize", Weight: 2})
+	defer server.Close()
+
+	pod := map[string]interface{}{}
+
+	nodeNames, err := e.Filter(pod, []string{"node-good", "node-bad"})
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+	if len(nodeNames) != 1 || nodeNames[0] != "node-good" {
+		t.Fatalf("Filter result = %v, want [node-good]", nodeNames)
+	}
+
+	scores, weight, err := e.Prioritize(pod, nodeNames)
+	if err != nil {
+		t.Fatalf("Prioritize: %v", err)
+	}
+	if weight != 2 {
+		t.Errorf("weight = %v, want 2", weight)
+	}
+	if len(scores) != 1 || scores[0].Host != "node-good" || scores[0].Score != 1 {
+		t.Fatalf("scores = %v, want [{node-good 1}]", scores)
+	}
+}
+
+func TestRunExtendersIntersectsAndScores(t *testing.T) {
+
+	e, server := newTestExtender(t, ExtenderConfig{FilterVerb: "filter", PrioritizeVerb: "prioritize", Weight: 3})
+	defer server.Close()
+
+	s := &Scheduler{extenders: []*Extender{e}}
+
+	rankings := rankings{
+		{nodeName: "node-good", weight: 1},
+		{nodeName: "node-bad", weight: 1},
+	}
+
+	out, err := s.runExtenders(map[string]interface{}{}, rankings)
+	if err != nil {
+		t.Fatalf("runExtenders: %v", err)
+	}
+
+	if len(out) != 1 || out[0].nodeName != "node-good" {
+		t.Fatalf("runExtenders result = %v, want only node-good", out)
+	}
+
+	if out[0].weight != 1+float64(1*3) {
+		t.Errorf("weight = %v, want %v", out[0].weight, 1+float64(1*3))
+	}
+}
+
+func TestExtenderManages(t *testing.T) {
+
+	gpuPod := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{
+					"resources": map[string]interface{}{
+						"requests": map[string]interface{}{
+							"nvidia.com/gpu": "1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	plainPod := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{
+					"resources": map[string]interface{}{
+						"requests": map[string]interface{}{
+							"cpu": "1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		note             string
+		managedResources []string
+		pod              map[string]interface{}
+		want             bool
+	}{
+		{"no managedResources manages everything", nil, plainPod, true},
+		{"matching resource is managed", []string{"nvidia.com/gpu"}, gpuPod, true},
+		{"non-matching resource is not managed", []string{"nvidia.com/gpu"}, plainPod, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			e := &Extender{config: &ExtenderConfig{ManagedResources: tc.managedResources}}
+			if got := e.manages(tc.pod); got != tc.want {
+				t.Errorf("manages() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtenderBind(t *testing.T) {
+
+	e, server := newTestExtender(t, ExtenderConfig{FilterVerb: "filter", BindVerb: "bind"})
+	defer server.Close()
+
+	if err := e.Bind("pod-1", "default", "uid-1", "node-good"); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/client/leaderelection"
+	"k8s.io/kubernetes/pkg/client/leaderelection/resourcelock"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/util/uuid"
+)
+
+// LeaderElectionConfig controls whether the scheduler coordinates with other
+// replicas of itself so that only one replica schedules pods at a time. The
+// OPA HTTP server keeps serving policy pushes on every replica that has not
+// lost leadership. A replica that loses leadership exits the whole process
+// (OnStoppedLeading calls glog.Fatalf), its OPA HTTP server included; it does
+// not return to standby.
+type LeaderElectionConfig struct {
+	ResourceName      string
+	ResourceNamespace string
+	LeaseDuration     time.Duration
+	RenewDeadline     time.Duration
+	RetryPeriod       time.Duration
+}
+
+// startWithLeaderElection wraps run() so that it only executes while this
+// process holds the lock described by s.leaderElection.
+func (s *Scheduler) startWithLeaderElection() error {
+
+	c, err := client.New(s.config)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	id := hostname + "_" + string(uuid.NewUUID())
+
+	lock, err := resourcelock.New(
+		resourcelock.EndpointsResourceLock,
+		s.leaderElection.ResourceNamespace,
+		s.leaderElection.ResourceName,
+		c,
+		resourcelock.ResourceLockConfig{Identity: id},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: s.leaderElection.LeaseDuration,
+		RenewDeadline: s.leaderElection.RenewDeadline,
+		RetryPeriod:   s.leaderElection.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				glog.Infof("Acquired leadership as %v, starting scheduling loop.", id)
+				s.run(stop)
+			},
+			OnStoppedLeading: func() {
+				glog.Fatalf("Lost leadership as %v, scheduling loop stopped.", id)
+			},
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	go elector.Run()
+
+	return nil
+}
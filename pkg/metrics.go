@@ -0,0 +1,97 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	podsScheduledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_pods_scheduled_total",
+		Help: "Total number of pod scheduling attempts, by result (scheduled, error, unschedulable, preempted).",
+	}, []string{"result"})
+
+	e2eSchedulingDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scheduler_e2e_scheduling_duration_seconds",
+		Help:    "End-to-end latency of a single schedulePod call, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	queryDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scheduler_query_duration_seconds",
+		Help:    "Latency of the OPA fit document topdown query, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	bindingDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scheduler_binding_duration_seconds",
+		Help:    "Latency of binding a pod to a node, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	storeWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scheduler_store_write_duration_seconds",
+		Help:    "Latency of writing a scheduled pod into the OPA store, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	pendingPods = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_pending_pods",
+		Help: "Number of pods currently being considered for scheduling.",
+	})
+
+	reflectorEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_reflector_events_total",
+		Help: "Total number of reflector events received, by resource type.",
+	}, []string{"resourceType"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		podsScheduledTotal,
+		e2eSchedulingDuration,
+		queryDuration,
+		bindingDuration,
+		storeWriteDuration,
+		pendingPods,
+		reflectorEventsTotal,
+	)
+}
+
+// NewMetricsHandler returns an http.Handler serving /metrics (the counters
+// and histograms above), net/http/pprof's profiling endpoints, and
+// /healthz and /readyz, all suitable for mounting at a single
+// --metrics-bind-address. readyz only succeeds once ready reports true.
+func NewMetricsHandler(ready func() bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/metrics", prometheus.Handler())
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready == nil || !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	return mux
+}
@@ -0,0 +1,359 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// defaultPreemptionGracePeriodSeconds bounds how long a victim pod is given
+// to terminate gracefully before the next scheduling cycle retries binding
+// the preempting pod.
+const defaultPreemptionGracePeriodSeconds = 30
+
+// preemptCandidate is one node returned by the preempt document, together
+// with the victim pods (read back out of storage) needed to break ties.
+type preemptCandidate struct {
+	nodeName      string
+	victims       []map[string]interface{}
+	pdbViolations int
+}
+
+// maybePreempt is called once schedulePod has determined that pod does not
+// currently fit anywhere. If pod declares a priority, it queries the
+// preempt document for nodes that would fit pod after evicting some set of
+// lower-priority victims, evicts the victims on the best such node, and
+// nominates that node for pod so that a later scheduling cycle can bind it.
+// The returned bool reports whether a node was actually found and victims
+// evicted, so callers can distinguish preemption from plain unschedulability.
+func (s *Scheduler) maybePreempt(txn storage.Transaction, pod map[string]interface{}) (bool, error) {
+
+	podName, _ := s.getMetadata("name", pod)
+
+	if _, ok, err := getPriority(pod); err != nil {
+		return false, err
+	} else if !ok {
+		glog.Infof("Unable to schedule pod: %v: no nodes are available and pod has no priority", podName)
+		return false, nil
+	}
+
+	val, err := ast.InterfaceToValue(pod)
+	if err != nil {
+		return false, err
+	}
+
+	globals := storage.NewBindings()
+	globals.Put(ast.Var("requested_pod"), val)
+
+	params := topdown.NewQueryParams(s.server.Compiler(), s.store, txn, globals, s.preempt)
+
+	results, err := topdown.Query(params)
+	if err != nil {
+		return false, err
+	}
+
+	raw, ok := results.(map[string]interface{})
+	if !ok || len(raw) == 0 {
+		glog.Infof("Unable to schedule pod: %v: preemption found no candidate nodes", podName)
+		return false, nil
+	}
+
+	candidates := make([]*preemptCandidate, 0, len(raw))
+
+	for nodeName, v := range raw {
+		c, err := s.loadPreemptCandidate(txn, nodeName, v)
+		if err != nil {
+			return false, err
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.Sort(byPreemptionCost(candidates))
+
+	best := candidates[0]
+
+	for _, victim := range best.victims {
+		if err := s.deletePod(victim); err != nil {
+			return false, err
+		}
+	}
+
+	if err := s.nominate(txn, pod, best.nodeName); err != nil {
+		return false, err
+	}
+
+	glog.Infof("Preempting %v pod(s) on %v to make room for pod %v", len(best.victims), best.nodeName, podName)
+
+	return true, nil
+}
+
+func (s *Scheduler) loadPreemptCandidate(txn storage.Transaction, nodeName string, raw interface{}) (*preemptCandidate, error) {
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("malformed preempt document for node %v: %v", nodeName, raw)
+	}
+
+	uids, _ := obj["victims"].([]interface{})
+	pdbViolations, _ := obj["pdbViolations"].(float64)
+
+	victims := make([]map[string]interface{}, 0, len(uids))
+
+	for _, u := range uids {
+		uid, ok := u.(string)
+		if !ok {
+			return nil, fmt.Errorf("malformed victim uid for node %v: %v", nodeName, u)
+		}
+
+		ref := ast.MustParseRef(fmt.Sprintf("data.pods[%q]", uid))
+
+		v, err := s.store.Read(txn, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		victim, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("malformed victim pod %v for node %v", uid, nodeName)
+		}
+
+		victims = append(victims, victim)
+	}
+
+	return &preemptCandidate{
+		nodeName:      nodeName,
+		victims:       victims,
+		pdbViolations: int(pdbViolations),
+	}, nil
+}
+
+// byPreemptionCost orders candidates by the tie-breakers used by upstream
+// kube-scheduler: fewest PDB violations, lowest highest victim priority,
+// lowest sum of victim priorities, fewest victims, earliest victim start
+// time.
+type byPreemptionCost []*preemptCandidate
+
+func (c byPreemptionCost) Len() int      { return len(c) }
+func (c byPreemptionCost) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+func (c byPreemptionCost) Less(i, j int) bool {
+	a, b := c[i], c[j]
+
+	if a.pdbViolations != b.pdbViolations {
+		return a.pdbViolations < b.pdbViolations
+	}
+
+	if ap, bp := highestPriority(a.victims), highestPriority(b.victims); ap != bp {
+		return ap < bp
+	}
+
+	if as, bs := sumPriorities(a.victims), sumPriorities(b.victims); as != bs {
+		return as < bs
+	}
+
+	if len(a.victims) != len(b.victims) {
+		return len(a.victims) < len(b.victims)
+	}
+
+	return earliestStartTime(a.victims) < earliestStartTime(b.victims)
+}
+
+// deletePod issues a graceful DELETE for a victim pod.
+func (s *Scheduler) deletePod(pod map[string]interface{}) error {
+
+	name, err := s.getMetadata("name", pod)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := s.getMetadata("namespace", pod)
+	if err != nil {
+		return err
+	}
+
+	grace := int64(defaultPreemptionGracePeriodSeconds)
+
+	opts := deleteOptions{
+		APIVersion:         "v1",
+		Kind:               "DeleteOptions",
+		GracePeriodSeconds: &grace,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(opts); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%v/namespaces/%v/pods/%v", baseURLFor(s.config), namespace, name)
+
+	req, err := http.NewRequest("DELETE", url, buf)
+	if err != nil {
+		return err
+	}
+
+	client, err := clientFor(s.config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode > http.StatusOK {
+		return httpErr(req, resp)
+	}
+
+	return nil
+}
+
+type deleteOptions struct {
+	APIVersion         string `json:"apiVersion"`
+	Kind               string `json:"kind"`
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+}
+
+// nominate records nodeName as the node the next scheduling cycle should
+// bind pod to: it PATCHes status.nominatedNodeName on the API server and
+// writes the same mapping into the OPA store so that fit queries for other
+// pods can see it while the victims are terminating.
+func (s *Scheduler) nominate(txn storage.Transaction, pod map[string]interface{}, nodeName string) error {
+
+	name, err := s.getMetadata("name", pod)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := s.getMetadata("namespace", pod)
+	if err != nil {
+		return err
+	}
+
+	uid, err := s.getUID(pod)
+	if err != nil {
+		return err
+	}
+
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"nominatedNodeName": nodeName,
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := json.NewEncoder(buf).Encode(patch); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%v/namespaces/%v/pods/%v/status", baseURLFor(s.config), namespace, name)
+
+	req, err := http.NewRequest("PATCH", url, buf)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+
+	client, err := clientFor(s.config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode > http.StatusOK {
+		return httpErr(req, resp)
+	}
+
+	ref := ast.MustParseRef(fmt.Sprintf("data.nominated[%q]", uid))
+
+	return s.store.Write(txn, storage.AddOp, ref, nodeName)
+}
+
+func getPriority(pod map[string]interface{}) (int64, bool, error) {
+	spec, ok := pod["spec"].(map[string]interface{})
+	if !ok {
+		return 0, false, fmt.Errorf("malformed pod: %v", pod)
+	}
+
+	p, ok := spec["priority"]
+	if !ok {
+		return 0, false, nil
+	}
+
+	f, ok := p.(float64)
+	if !ok {
+		return 0, false, fmt.Errorf("malformed pod priority: %v", p)
+	}
+
+	return int64(f), true, nil
+}
+
+func podPriority(pod map[string]interface{}) int64 {
+	p, _, _ := getPriority(pod)
+	return p
+}
+
+func highestPriority(victims []map[string]interface{}) int64 {
+	var max int64
+	for i, v := range victims {
+		if p := podPriority(v); i == 0 || p > max {
+			max = p
+		}
+	}
+	return max
+}
+
+func sumPriorities(victims []map[string]interface{}) int64 {
+	var sum int64
+	for _, v := range victims {
+		sum += podPriority(v)
+	}
+	return sum
+}
+
+func earliestStartTime(victims []map[string]interface{}) int64 {
+	var min int64
+	for i, v := range victims {
+		if t := startTime(v); i == 0 || t < min {
+			min = t
+		}
+	}
+	return min
+}
+
+func startTime(pod map[string]interface{}) int64 {
+	meta, ok := pod["metadata"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	ts, ok := meta["creationTimestamp"].(string)
+	if !ok {
+		return 0
+	}
+
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return 0
+	}
+
+	return t.Unix()
+}
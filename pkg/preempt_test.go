@@ -0,0 +1,187 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+func TestByPreemptionCostLess(t *testing.T) {
+
+	pod := func(priority float64, startTime string) map[string]interface{} {
+		return map[string]interface{}{
+			"spec": map[string]interface{}{
+				"priority": priority,
+			},
+			"metadata": map[string]interface{}{
+				"creationTimestamp": startTime,
+			},
+		}
+	}
+
+	cases := []struct {
+		note string
+		a    *preemptCandidate
+		b    *preemptCandidate
+		want bool
+	}{
+		{
+			note: "fewer pdb violations wins",
+			a:    &preemptCandidate{pdbViolations: 0},
+			b:    &preemptCandidate{pdbViolations: 1},
+			want: true,
+		},
+		{
+			note: "more pdb violations loses",
+			a:    &preemptCandidate{pdbViolations: 1},
+			b:    &preemptCandidate{pdbViolations: 0},
+			want: false,
+		},
+		{
+			note: "lower highest victim priority wins when pdb violations tie",
+			a:    &preemptCandidate{victims: []map[string]interface{}{pod(10, "2016-01-01T00:00:00Z")}},
+			b:    &preemptCandidate{victims: []map[string]interface{}{pod(20, "2016-01-01T00:00:00Z")}},
+			want: true,
+		},
+		{
+			note: "lower sum of priorities wins when pdb violations and highest priority tie",
+			a: &preemptCandidate{victims: []map[string]interface{}{
+				pod(10, "2016-01-01T00:00:00Z"),
+				pod(1, "2016-01-01T00:00:00Z"),
+			}},
+			b: &preemptCandidate{victims: []map[string]interface{}{
+				pod(10, "2016-01-01T00:00:00Z"),
+				pod(9, "2016-01-01T00:00:00Z"),
+			}},
+			want: true,
+		},
+		{
+			note: "fewer victims wins when highest priority and priority sums tie",
+			a: &preemptCandidate{victims: []map[string]interface{}{
+				pod(10, "2016-01-01T00:00:00Z"),
+			}},
+			b: &preemptCandidate{victims: []map[string]interface{}{
+				pod(10, "2016-01-01T00:00:00Z"),
+				pod(0, "2016-01-01T00:00:00Z"),
+			}},
+			want: true,
+		},
+		{
+			note: "earlier start time wins when everything else ties",
+			a: &preemptCandidate{victims: []map[string]interface{}{
+				pod(10, "2016-01-01T00:00:00Z"),
+			}},
+			b: &preemptCandidate{victims: []map[string]interface{}{
+				pod(10, "2016-01-02T00:00:00Z"),
+			}},
+			want: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			candidates := byPreemptionCost{tc.a, tc.b}
+			if got := candidates.Less(0, 1); got != tc.want {
+				t.Fatalf("Less(0, 1) = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("sort orders candidates from cheapest to most expensive", func(t *testing.T) {
+		cheap := &preemptCandidate{nodeName: "cheap", pdbViolations: 0}
+		expensive := &preemptCandidate{nodeName: "expensive", pdbViolations: 1}
+		candidates := byPreemptionCost{expensive, cheap}
+		sort.Sort(candidates)
+		if candidates[0].nodeName != "cheap" {
+			t.Fatalf("expected cheap candidate first, got %v", candidates[0].nodeName)
+		}
+	})
+}
+
+func newTestStore(t *testing.T) *storage.Storage {
+	t.Helper()
+	store := storage.New(storage.InMemoryConfig())
+	if err := store.Open(); err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	return store
+}
+
+func TestLoadPreemptCandidate(t *testing.T) {
+
+	store := newTestStore(t)
+
+	txn, err := store.NewTransaction()
+	if err != nil {
+		t.Fatalf("new transaction: %v", err)
+	}
+	defer store.Close(txn)
+
+	if err := store.Write(txn, storage.AddOp, ast.MustParseRef("data.pods"), map[string]interface{}{}); err != nil {
+		t.Fatalf("write data.pods: %v", err)
+	}
+
+	victim := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"uid": "victim-1",
+		},
+	}
+
+	if err := store.Write(txn, storage.AddOp, ast.MustParseRef(`data.pods["victim-1"]`), victim); err != nil {
+		t.Fatalf("write victim pod: %v", err)
+	}
+
+	s := &Scheduler{store: store}
+
+	t.Run("loads victims and pdb violations", func(t *testing.T) {
+		raw := map[string]interface{}{
+			"victims":       []interface{}{"victim-1"},
+			"pdbViolations": float64(2),
+		}
+
+		c, err := s.loadPreemptCandidate(txn, "node-1", raw)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if c.nodeName != "node-1" {
+			t.Errorf("nodeName = %v, want node-1", c.nodeName)
+		}
+		if c.pdbViolations != 2 {
+			t.Errorf("pdbViolations = %v, want 2", c.pdbViolations)
+		}
+		if len(c.victims) != 1 {
+			t.Fatalf("len(victims) = %v, want 1", len(c.victims))
+		}
+	})
+
+	t.Run("rejects a malformed preempt document entry", func(t *testing.T) {
+		if _, err := s.loadPreemptCandidate(txn, "node-1", "not-a-map"); err == nil {
+			t.Fatal("expected error for non-map preempt document entry")
+		}
+	})
+
+	t.Run("rejects a non-string victim uid", func(t *testing.T) {
+		raw := map[string]interface{}{
+			"victims": []interface{}{42},
+		}
+		if _, err := s.loadPreemptCandidate(txn, "node-1", raw); err == nil {
+			t.Fatal("expected error for non-string victim uid")
+		}
+	})
+
+	t.Run("rejects a victim uid that is not in storage", func(t *testing.T) {
+		raw := map[string]interface{}{
+			"victims": []interface{}{"does-not-exist"},
+		}
+		if _, err := s.loadPreemptCandidate(txn, "node-1", raw); err == nil {
+			t.Fatal("expected error for unknown victim uid")
+		}
+	})
+}
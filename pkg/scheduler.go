@@ -9,7 +9,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/kubernetes/pkg/client/restclient"
@@ -20,39 +23,111 @@ import (
 	"github.com/open-policy-agent/opa/server"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/topdown"
+
+	"github.com/open-policy-agent/opa-kube-scheduler/apis/config/v1alpha1"
 )
 
 // Scheduler implements ...
 type Scheduler struct {
-	store  *storage.Storage
-	server *server.Server
-	fit    []interface{}
-	config *restclient.Config
+	store          *storage.Storage
+	server         *server.Server
+	fit            []interface{}
+	preempt        []interface{}
+	config         *restclient.Config
+	extenders      []*Extender
+	leaderElection *LeaderElectionConfig
+	reflectors     []v1alpha1.ReflectorConfiguration
+
+	readyMu     sync.Mutex
+	syncedTypes map[string]bool
+	ready       bool
+}
+
+// Ready reports whether the reflector sync barrier has closed, i.e.
+// whether nodes, services, and replicationcontrollers have all completed
+// their initial LIST and the scheduler has started considering pods. It is
+// intended for a /readyz endpoint.
+func (s *Scheduler) Ready() bool {
+	s.readyMu.Lock()
+	defer s.readyMu.Unlock()
+	return s.ready
 }
 
-// New returns a new Scheduler object.
-func New(server *server.Server, store *storage.Storage, fit []interface{}, config *restclient.Config) *Scheduler {
+// New returns a new Scheduler configured by conf. restConfig is the REST
+// client configuration used to talk to the API server (including the
+// leader election client); the caller builds it from conf.ClientConnection.
+func New(server *server.Server, store *storage.Storage, restConfig *restclient.Config, conf *v1alpha1.KubeSchedulerConfiguration) (*Scheduler, error) {
+
+	fit, err := parseDocPath(conf.FitDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	preempt, err := parseDocPath(conf.PreemptDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	extenders, err := extendersFromConfig(conf.Extenders)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaderElection *LeaderElectionConfig
+	if conf.LeaderElection.LeaderElect {
+		leaderElection = &LeaderElectionConfig{
+			ResourceName:      conf.LeaderElection.ResourceName,
+			ResourceNamespace: conf.LeaderElection.ResourceNamespace,
+			LeaseDuration:     conf.LeaderElection.LeaseDuration.Duration,
+			RenewDeadline:     conf.LeaderElection.RenewDeadline.Duration,
+			RetryPeriod:       conf.LeaderElection.RetryPeriod.Duration,
+		}
+	}
+
 	return &Scheduler{
-		store:  store,
-		server: server,
-		fit:    fit,
-		config: config,
+		store:          store,
+		server:         server,
+		fit:            fit,
+		preempt:        preempt,
+		config:         restConfig,
+		extenders:      extenders,
+		leaderElection: leaderElection,
+		reflectors:     conf.Reflectors,
+	}, nil
+}
+
+// parseDocPath converts a document path such as "/io/k8s/scheduler/fit"
+// into the []interface{} form expected by topdown.NewQueryParams.
+func parseDocPath(p string) ([]interface{}, error) {
+	if len(p) == 0 || p[0] != '/' {
+		return nil, fmt.Errorf("invalid document path: %v", p)
+	}
+	parts := strings.Split(p[1:], "/")
+	r := make([]interface{}, len(parts))
+	for i := range parts {
+		r[i] = parts[i]
 	}
+	return r, nil
 }
 
-// Start causes the scheduler to begin scheduling pods.
+// Start causes the scheduler to begin scheduling pods. If leader election is
+// configured, scheduling only happens while this process holds the lock;
+// otherwise scheduling starts immediately.
 func (s *Scheduler) Start() error {
 	if err := s.init(); err != nil {
 		return err
 	}
-	s.run()
+	if s.leaderElection != nil {
+		return s.startWithLeaderElection()
+	}
+	s.run(make(chan struct{}))
 	return nil
 }
 
 func (s *Scheduler) init() error {
 
 	baseDocs := []string{
-		"pods", "nodes", "replicationcontrollers", "services",
+		"pods", "nodes", "replicationcontrollers", "services", "nominated",
 	}
 
 	txn, err := s.store.NewTransaction()
@@ -80,54 +155,135 @@ type msg struct {
 	payload      interface{}
 }
 
-func (s *Scheduler) run() {
+func (s *Scheduler) run(stopCh <-chan struct{}) {
+
+	fieldSelectors := make(map[string]string, len(s.reflectors))
+	for _, r := range s.reflectors {
+		fieldSelectors[r.Name] = r.FieldSelector
+	}
 
 	// This table defines the reflectors that will be started. The action
 	// is the function that will be called when a message from the reflector
-	// is received.
+	// is received. Field selectors come from s.reflectors (defaulted in
+	// v1alpha1.KubeSchedulerConfiguration.Default), keyed by the constants
+	// in that package rather than resourceType since "pods" appears twice
+	// below with different selectors.
 	//
-	// TODO(tsandall): implement barrier so that the unscheduled pod reflector
-	// does not start until all of the other reflectors have sent resync messages.
-	// currently if scheduler is started while there are unscheduled pods, they
-	// will fail to schedule (because no nodes have synched).
+	// barriered marks the unscheduled-pods reflector, whose start is
+	// deferred until barrierResourceTypes have all reported an initial
+	// resync; otherwise pods can be considered for scheduling against a
+	// node/service/replicationcontroller view that hasn't finished its
+	// initial LIST yet and spuriously fail to fit anywhere.
 	spec := []struct {
 		action        action
 		resourceType  string
 		fieldSelector string
+		barriered     bool
 	}{
-		{s.schedule, "pods", "spec.nodeName==,status.phase!=Succeeded,status.phase!=Failed"},
-		{s.patch, "pods", "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed"},
-		{s.patch, "nodes", "spec.unschedulable=false"},
-		{s.patch, "services", ""},
-		{s.patch, "replicationcontrollers", ""},
+		{s.schedule, "pods", fieldSelectors[v1alpha1.ReflectorUnscheduledPods], true},
+		{s.patch, "pods", fieldSelectors[v1alpha1.ReflectorScheduledPods], false},
+		{s.patch, "nodes", fieldSelectors[v1alpha1.ReflectorNodes], false},
+		{s.patch, "services", fieldSelectors[v1alpha1.ReflectorServices], false},
+		{s.patch, "replicationcontrollers", fieldSelectors[v1alpha1.ReflectorReplicationControllers], false},
+	}
+
+	barrierResourceTypes := map[string]bool{
+		"nodes":                  true,
+		"services":               true,
+		"replicationcontrollers": true,
+	}
+
+	s.readyMu.Lock()
+	s.syncedTypes = map[string]bool{}
+	s.ready = false
+	s.readyMu.Unlock()
+
+	barrierCh := make(chan struct{})
+
+	checkBarrier := func() {
+		s.readyMu.Lock()
+		defer s.readyMu.Unlock()
+		if s.ready {
+			return
+		}
+		for rt := range barrierResourceTypes {
+			if !s.syncedTypes[rt] {
+				return
+			}
+		}
+		s.ready = true
+		close(barrierCh)
 	}
 
 	mux := make(chan *msg)
 
-	// Start the reflectors.
-	for _, sp := range spec {
+	startReflector := func(sp struct {
+		action        action
+		resourceType  string
+		fieldSelector string
+		barriered     bool
+	}) {
 		r, err := newReflector(s.config, sp.resourceType, sp.fieldSelector)
 		if err != nil {
+			glog.Errorf("Unable to start reflector for %v: %v", sp.resourceType, err)
 			return
 		}
 		r.Start()
-		sp := sp
 		go func() {
-			for x := range r.Rx {
-				mux <- &msg{
-					action:       sp.action,
-					resourceType: sp.resourceType,
-					payload:      x,
+			for {
+				select {
+				case x, ok := <-r.Rx:
+					if !ok {
+						return
+					}
+					if _, ok := x.(*resync); ok && barrierResourceTypes[sp.resourceType] {
+						s.readyMu.Lock()
+						s.syncedTypes[sp.resourceType] = true
+						s.readyMu.Unlock()
+						checkBarrier()
+					}
+					reflectorEventsTotal.WithLabelValues(sp.resourceType).Inc()
+					mux <- &msg{
+						action:       sp.action,
+						resourceType: sp.resourceType,
+						payload:      x,
+					}
+				case <-stopCh:
+					return
 				}
 			}
 		}()
 	}
 
+	// Start the reflectors. The barriered (unscheduled pods) reflector
+	// isn't started until barrierCh closes, so it never buffers events
+	// from a cluster view that's only partially synced.
+	for _, sp := range spec {
+		sp := sp
+		if sp.barriered {
+			go func() {
+				select {
+				case <-barrierCh:
+				case <-stopCh:
+					return
+				}
+				startReflector(sp)
+			}()
+			continue
+		}
+		startReflector(sp)
+	}
+
 	// Process updates from the reflectors.
 	go func() {
-		for msg := range mux {
-			if err := msg.action(msg.resourceType, msg.payload); err != nil {
-				glog.Errorf("Error handling update (%T) for %v: %v", msg.payload, msg.resourceType, err)
+		for {
+			select {
+			case msg := <-mux:
+				if err := msg.action(msg.resourceType, msg.payload); err != nil {
+					glog.Errorf("Error handling update (%T) for %v: %v", msg.payload, msg.resourceType, err)
+				}
+			case <-stopCh:
+				return
 			}
 		}
 	}()
@@ -137,12 +293,17 @@ func (s *Scheduler) schedule(resourceType string, payload interface{}) error {
 	switch payload := payload.(type) {
 	case *resync:
 		for _, item := range payload.Items {
-			if err := s.schedulePod(item.(map[string]interface{})); err != nil {
+			pendingPods.Inc()
+			err := s.schedulePod(item.(map[string]interface{}))
+			pendingPods.Dec()
+			if err != nil {
 				return err
 			}
 		}
 	case *sync:
 		if payload.Type == added {
+			pendingPods.Inc()
+			defer pendingPods.Dec()
 			return s.schedulePod(payload.Object)
 		}
 	case error:
@@ -153,6 +314,14 @@ func (s *Scheduler) schedule(resourceType string, payload interface{}) error {
 
 func (s *Scheduler) schedulePod(pod map[string]interface{}) error {
 
+	e2eStart := time.Now()
+	result := "error"
+
+	defer func() {
+		podsScheduledTotal.WithLabelValues(result).Inc()
+		e2eSchedulingDuration.Observe(time.Since(e2eStart).Seconds())
+	}()
+
 	uid, err := s.getUID(pod)
 	if err != nil {
 		return err
@@ -187,6 +356,7 @@ func (s *Scheduler) schedulePod(pod map[string]interface{}) error {
 	}
 
 	queryTime := time.Since(t0)
+	queryDuration.Observe(queryTime.Seconds())
 
 	var rankings rankings
 
@@ -197,16 +367,38 @@ func (s *Scheduler) schedulePod(pod map[string]interface{}) error {
 			rankings = append(rankings, ranking{k, w})
 		}
 	case topdown.Undefined:
+		result = "unschedulable"
 		glog.Infof("Unable to schedule pod: %v: fit document is undefined (took query:%v)", podName, queryTime)
 		return nil
 	default:
+		result = "unschedulable"
 		glog.Infof("Unable to schedule pod: %v: fit document is malformed (took query:%v)", podName, queryTime)
 		return nil
 	}
 
+	if len(s.extenders) > 0 && len(rankings) > 0 {
+		rankings, err = s.runExtenders(pod, rankings)
+		if err != nil {
+			return err
+		}
+	}
+
 	sort.Sort(rankings)
 
 	if len(rankings) == 0 {
+		if s.preempt != nil {
+			preempted, err := s.maybePreempt(txn, pod)
+			if err != nil {
+				return err
+			}
+			if preempted {
+				result = "preempted"
+			} else {
+				result = "unschedulable"
+			}
+			return nil
+		}
+		result = "unschedulable"
 		glog.Infof("Unable to schedule pod: %v: no nodes are available (took query:%v)", podName, queryTime)
 		return nil
 	}
@@ -224,6 +416,7 @@ func (s *Scheduler) schedulePod(pod map[string]interface{}) error {
 	}
 
 	storageTime := time.Since(t0)
+	storeWriteDuration.Observe(storageTime.Seconds())
 
 	t0 = time.Now()
 
@@ -236,12 +429,73 @@ func (s *Scheduler) schedulePod(pod map[string]interface{}) error {
 	}
 
 	bindTime := time.Since(t0)
+	bindingDuration.Observe(bindTime.Seconds())
+
+	result = "scheduled"
 
 	glog.Infof("Scheduling pod %v to %v (took query:%v storage:%v bind:%v)", podName, nodeName, queryTime, storageTime, bindTime)
 
 	return nil
 }
 
+// runExtenders consults the configured extenders, in order, to filter and
+// score the nodes the OPA fit document already considers feasible. Filter
+// results from successive extenders are intersected; prioritize scores are
+// added into the rankings returned by the fit document.
+func (s *Scheduler) runExtenders(pod map[string]interface{}, rankings rankings) (rankings, error) {
+
+	nodeNames := make([]string, len(rankings))
+	for i, r := range rankings {
+		nodeNames[i] = r.nodeName
+	}
+
+	for _, e := range s.extenders {
+		if !e.manages(pod) {
+			continue
+		}
+
+		filtered, err := e.Filter(pod, nodeNames)
+		if err != nil {
+			if e.config.Ignorable {
+				glog.Errorf("Ignoring extender filter error: %v", err)
+				continue
+			}
+			return nil, err
+		}
+
+		nodeNames = filtered
+
+		scores, weight, err := e.Prioritize(pod, nodeNames)
+		if err != nil {
+			if e.config.Ignorable {
+				glog.Errorf("Ignoring extender prioritize error: %v", err)
+				continue
+			}
+			return nil, err
+		}
+
+		for _, score := range scores {
+			for i := range rankings {
+				if rankings[i].nodeName == score.Host {
+					rankings[i].weight += float64(score.Score * weight)
+				}
+			}
+		}
+	}
+
+	filtered := rankings[:0]
+	for _, r := range rankings {
+		for _, n := range nodeNames {
+			if r.nodeName == n {
+				filtered = append(filtered, r)
+				break
+			}
+		}
+	}
+
+	return filtered, nil
+}
+
 func (s *Scheduler) bindPod(pod map[string]interface{}) error {
 
 	podName, err := s.getMetadata("name", pod)
@@ -259,6 +513,16 @@ func (s *Scheduler) bindPod(pod map[string]interface{}) error {
 		return err
 	}
 
+	for _, e := range s.extenders {
+		if e.IsBinder() && e.manages(pod) {
+			uid, err := s.getUID(pod)
+			if err != nil {
+				return err
+			}
+			return e.Bind(podName, namespace, uid, nodeName)
+		}
+	}
+
 	b := binding{
 		APIVersion: "v1",
 		Kind:       "Binding",
@@ -326,20 +590,85 @@ func (s *Scheduler) patch(resourceType string, payload interface{}) error {
 	return nil
 }
 
+// patchOp applies a reflector event to the store. For ReplaceOp it diffs
+// the incoming object against what's currently stored and only writes the
+// subpaths that actually changed, rather than rewriting the whole object --
+// this keeps topdown query caches from being invalidated by trivial updates
+// (e.g. a status heartbeat) to large objects.
 func (s *Scheduler) patchOp(resourceType string, op storage.PatchOp, obj interface{}) error {
 	uid, err := s.getUID(obj)
 	if err != nil {
 		return err
 	}
-	path := ast.MustParseRef(fmt.Sprintf("data.%v[%q]", resourceType, uid))
+
+	base := fmt.Sprintf("data.%v[%q]", resourceType, uid)
+	path := ast.MustParseRef(base)
+
 	txn, err := s.store.NewTransaction()
 	if err != nil {
 		return err
 	}
 	defer s.store.Close(txn)
+
+	if op == storage.ReplaceOp {
+		if old, err := s.store.Read(txn, path); err == nil {
+			if oldObj, ok := old.(map[string]interface{}); ok {
+				if newObj, ok := obj.(map[string]interface{}); ok {
+					return s.diffAndWrite(txn, base, oldObj, newObj)
+				}
+			}
+		}
+	}
+
 	return s.store.Write(txn, op, path, obj)
 }
 
+// diffAndWrite recursively compares old and new, writing only the subpaths
+// of base (e.g. `data.pods["uid"].status`) that changed between them.
+func (s *Scheduler) diffAndWrite(txn storage.Transaction, base string, old, updated map[string]interface{}) error {
+	for k, newVal := range updated {
+		path := fmt.Sprintf("%s[%q]", base, k)
+
+		oldVal, existed := old[k]
+		if !existed {
+			if err := s.writePath(txn, storage.AddOp, path, newVal); err != nil {
+				return err
+			}
+			continue
+		}
+
+		oldMap, oldIsMap := oldVal.(map[string]interface{})
+		newMap, newIsMap := newVal.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			if err := s.diffAndWrite(txn, path, oldMap, newMap); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(oldVal, newVal) {
+			if err := s.writePath(txn, storage.ReplaceOp, path, newVal); err != nil {
+				return err
+			}
+		}
+	}
+
+	for k := range old {
+		if _, existed := updated[k]; !existed {
+			path := fmt.Sprintf("%s[%q]", base, k)
+			if err := s.writePath(txn, storage.RemoveOp, path, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) writePath(txn storage.Transaction, op storage.PatchOp, path string, value interface{}) error {
+	return s.store.Write(txn, op, ast.MustParseRef(path), value)
+}
+
 func (s *Scheduler) getNodeName(pod map[string]interface{}) (string, error) {
 	if m, ok := pod["spec"].(map[string]interface{}); ok {
 		if v, ok := m["nodeName"].(string); ok {
@@ -0,0 +1,96 @@
+// Copyright 2016 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+func TestDiffAndWrite(t *testing.T) {
+
+	cases := []struct {
+		note string
+		old  map[string]interface{}
+		new  map[string]interface{}
+	}{
+		{
+			note: "adds a new field",
+			old:  map[string]interface{}{"a": "1"},
+			new:  map[string]interface{}{"a": "1", "b": "2"},
+		},
+		{
+			note: "replaces a changed field",
+			old:  map[string]interface{}{"a": "1"},
+			new:  map[string]interface{}{"a": "2"},
+		},
+		{
+			note: "removes a deleted field",
+			old:  map[string]interface{}{"a": "1", "b": "2"},
+			new:  map[string]interface{}{"a": "1"},
+		},
+		{
+			note: "recurses into nested maps",
+			old: map[string]interface{}{
+				"status": map[string]interface{}{
+					"phase": "Pending",
+					"host":  "node-1",
+				},
+			},
+			new: map[string]interface{}{
+				"status": map[string]interface{}{
+					"phase": "Running",
+					"host":  "node-1",
+				},
+			},
+		},
+		{
+			note: "leaves an unchanged object untouched",
+			old:  map[string]interface{}{"a": "1"},
+			new:  map[string]interface{}{"a": "1"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+
+			store := newTestStore(t)
+
+			txn, err := store.NewTransaction()
+			if err != nil {
+				t.Fatalf("new transaction: %v", err)
+			}
+			defer store.Close(txn)
+
+			base := `data.pods["uid-1"]`
+
+			if err := store.Write(txn, storage.AddOp, ast.MustParseRef("data.pods"), map[string]interface{}{}); err != nil {
+				t.Fatalf("write data.pods: %v", err)
+			}
+
+			if err := store.Write(txn, storage.AddOp, ast.MustParseRef(base), tc.old); err != nil {
+				t.Fatalf("write old object: %v", err)
+			}
+
+			s := &Scheduler{store: store}
+
+			if err := s.diffAndWrite(txn, base, tc.old, tc.new); err != nil {
+				t.Fatalf("diffAndWrite: %v", err)
+			}
+
+			got, err := store.Read(txn, ast.MustParseRef(base))
+			if err != nil {
+				t.Fatalf("read back object: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tc.new) {
+				t.Errorf("got %#v, want %#v", got, tc.new)
+			}
+		})
+	}
+}